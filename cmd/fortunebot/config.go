@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const defaultProfileName = "default"
+
+// config is the fully-resolved, single-profile view of the user's settings
+// that the rest of fortunebot operates on.
+type config struct {
+	APIKey        string
+	DefaultPrompt string
+	Model         string
+	Provider      string
+	Providers     map[string]providerSettings
+	CacheTTL      *int
+
+	// Provenance, surfaced by --verbose to explain where a value came from.
+	ActiveProfile string
+	ConfigPath    string
+	ConfigFormat  string // "yaml", "json", or "" if no config file was found
+}
+
+// profileSettings is one named profile inside config.yaml.
+type profileSettings struct {
+	Prompt    string                      `yaml:"prompt" json:"prompt"`
+	Model     string                      `yaml:"model" json:"model"`
+	Provider  string                      `yaml:"provider" json:"provider"`
+	APIKey    string                      `yaml:"api_key" json:"api_key"`
+	CacheTTL  *int                        `yaml:"cache_ttl" json:"cache_ttl"`
+	Providers map[string]providerSettings `yaml:"providers" json:"providers"`
+}
+
+// yamlConfigFile is the top-level shape of config.yaml.
+type yamlConfigFile struct {
+	ActiveProfile string                     `yaml:"active_profile"`
+	Profiles      map[string]profileSettings `yaml:"profiles"`
+}
+
+// legacyConfigFile is the flat shape of the original config.json, kept so
+// users who haven't migrated to profiles keep working.
+type legacyConfigFile struct {
+	APIKey        string                      `json:"api_key"`
+	DefaultPrompt string                      `json:"default_prompt"`
+	Model         string                      `json:"model"`
+	Provider      string                      `json:"provider"`
+	Providers     map[string]providerSettings `json:"providers"`
+}
+
+// configPaths returns the YAML and legacy JSON config file candidates.
+func configPaths() (yamlPath, jsonPath string) {
+	return filepath.Join(filepath.Dir(configPath), "config.yaml"), configPath
+}
+
+// loadConfig loads the active profile, preferring config.yaml (with named
+// profiles) and falling back to the legacy flat config.json.
+func loadConfig(profileFlag string) config {
+	yamlPath, jsonPath := configPaths()
+
+	if b, err := os.ReadFile(yamlPath); err == nil {
+		var file yamlConfigFile
+		if err := yaml.Unmarshal(b, &file); err == nil {
+			return resolveProfile(file, profileFlag, yamlPath, "yaml")
+		}
+	}
+
+	if b, err := os.ReadFile(jsonPath); err == nil {
+		var legacy legacyConfigFile
+		if err := json.Unmarshal(b, &legacy); err == nil {
+			file := yamlConfigFile{
+				ActiveProfile: defaultProfileName,
+				Profiles: map[string]profileSettings{
+					defaultProfileName: {
+						Prompt:    legacy.DefaultPrompt,
+						Model:     legacy.Model,
+						Provider:  legacy.Provider,
+						APIKey:    legacy.APIKey,
+						Providers: legacy.Providers,
+					},
+				},
+			}
+			return resolveProfile(file, profileFlag, jsonPath, "json")
+		}
+	}
+
+	return config{DefaultPrompt: defaultPrompt, Model: defaultModel, Provider: defaultProvider}
+}
+
+// resolveProfile picks the active profile out of file and expands ${VAR}
+// references in its string fields against the process environment.
+func resolveProfile(file yamlConfigFile, profileFlag, path, format string) config {
+	name := defaultProfileName
+	switch {
+	case strings.TrimSpace(profileFlag) != "":
+		name = profileFlag
+	case os.Getenv("FORTUNEBOT_PROFILE") != "":
+		name = os.Getenv("FORTUNEBOT_PROFILE")
+	case strings.TrimSpace(file.ActiveProfile) != "":
+		name = file.ActiveProfile
+	}
+
+	p, ok := file.Profiles[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "[fortunebot] Profile %q not found in %s; using built-in defaults.\n", name, path)
+		return config{DefaultPrompt: defaultPrompt, Model: defaultModel, Provider: defaultProvider, ActiveProfile: name, ConfigPath: path, ConfigFormat: format}
+	}
+
+	cfg := config{
+		APIKey:        expandEnv(p.APIKey),
+		DefaultPrompt: expandEnv(p.Prompt),
+		Model:         expandEnv(p.Model),
+		Provider:      expandEnv(p.Provider),
+		Providers:     expandProviderSettings(p.Providers),
+		CacheTTL:      p.CacheTTL,
+		ActiveProfile: name,
+		ConfigPath:    path,
+		ConfigFormat:  format,
+	}
+	if cfg.DefaultPrompt == "" {
+		cfg.DefaultPrompt = defaultPrompt
+	}
+	if cfg.Model == "" {
+		cfg.Model = defaultModel
+	}
+	if cfg.Provider == "" {
+		cfg.Provider = defaultProvider
+	}
+	return cfg
+}
+
+// expandEnv expands ${VAR} references in s against the process environment.
+func expandEnv(s string) string {
+	if s == "" {
+		return s
+	}
+	return os.Expand(s, os.Getenv)
+}
+
+// expandProviderSettings expands ${VAR} references across a providers map.
+func expandProviderSettings(in map[string]providerSettings) map[string]providerSettings {
+	if in == nil {
+		return nil
+	}
+	out := make(map[string]providerSettings, len(in))
+	for name, s := range in {
+		out[name] = providerSettings{
+			Endpoint:   expandEnv(s.Endpoint),
+			AuthHeader: expandEnv(s.AuthHeader),
+			Model:      expandEnv(s.Model),
+		}
+	}
+	return out
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	logMaxSizeDefault  = 5 * 1024 * 1024 // 5MiB
+	logMaxFilesDefault = 5
+)
+
+// logRecord is one JSONL entry in fortunebot.log.
+type logRecord struct {
+	Timestamp  int64  `json:"ts"`
+	Model      string `json:"model"`
+	Provider   string `json:"provider"`
+	PromptHash string `json:"prompt_hash"`
+	Prompt     string `json:"prompt"`
+	Fortune    string `json:"fortune"`
+	LatencyMS  int64  `json:"latency_ms"`
+	Tokens     int    `json:"tokens,omitempty"`
+}
+
+// promptHash returns a short, stable fingerprint for grouping/searching by
+// prompt without storing duplicate long strings.
+func promptHash(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return fmt.Sprintf("%x", sum)[:12]
+}
+
+// logFortune appends a structured record to the log file (skipping error
+// messages), rotating the file first if it has grown past maxSize.
+func logFortune(rec logRecord, maxSize int64, maxFiles int) {
+	if isErrorFortune(rec.Fortune) {
+		return
+	}
+	rotateLogIfNeeded(maxSize, maxFiles)
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[fortunebot] Failed to encode log record: %v\n", err)
+		return
+	}
+	fh, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[fortunebot] Failed to write log: %v\n", err)
+		return
+	}
+	defer fh.Close()
+	if _, err := fh.Write(append(line, '\n')); err != nil {
+		fmt.Fprintf(os.Stderr, "[fortunebot] Failed to write log: %v\n", err)
+	}
+}
+
+// rotateLogIfNeeded gzips fortunebot.log into fortunebot.log.1.gz (shifting
+// older generations up to maxFiles) once it reaches maxSize. maxFiles <= 0
+// means keep none: the oversized log is simply dropped, not gzipped.
+func rotateLogIfNeeded(maxSize int64, maxFiles int) {
+	info, err := os.Stat(logPath)
+	if err != nil || info.Size() < maxSize {
+		return
+	}
+
+	if maxFiles <= 0 {
+		if err := os.Remove(logPath); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "[fortunebot] Failed to truncate log: %v\n", err)
+		}
+		return
+	}
+
+	if err := os.Remove(fmt.Sprintf("%s.%d.gz", logPath, maxFiles)); err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "[fortunebot] Failed to prune old log: %v\n", err)
+	}
+	for i := maxFiles - 1; i >= 1; i-- {
+		old := fmt.Sprintf("%s.%d.gz", logPath, i)
+		next := fmt.Sprintf("%s.%d.gz", logPath, i+1)
+		if _, err := os.Stat(old); err == nil {
+			if err := os.Rename(old, next); err != nil {
+				fmt.Fprintf(os.Stderr, "[fortunebot] Failed to rotate log: %v\n", err)
+			}
+		}
+	}
+
+	if err := gzipFile(logPath, fmt.Sprintf("%s.1.gz", logPath)); err != nil {
+		fmt.Fprintf(os.Stderr, "[fortunebot] Failed to compress rotated log: %v\n", err)
+		return
+	}
+	if err := os.Remove(logPath); err != nil {
+		fmt.Fprintf(os.Stderr, "[fortunebot] Failed to truncate log after rotation: %v\n", err)
+	}
+}
+
+// gzipFile compresses src into dst, leaving src untouched.
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		gz.Close()
+		return err
+	}
+	return gz.Close()
+}
+
+// rotatedLogPaths returns the gzipped rotated logs that currently exist,
+// oldest last.
+func rotatedLogPaths() []string {
+	var paths []string
+	for i := 1; ; i++ {
+		p := fmt.Sprintf("%s.%d.gz", logPath, i)
+		if _, err := os.Stat(p); err != nil {
+			break
+		}
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+// printLog streams the current log file to stdout, unmodified.
+func printLog() {
+	b, err := os.ReadFile(logPath)
+	if err != nil {
+		fmt.Println("[fortunebot] No log file found.")
+		return
+	}
+	fmt.Print(string(b))
+}
+
+// parseLogLine decodes one log line, supporting both the current JSONL
+// format and the original tab-separated "ts\tfortune" format so existing
+// users' logs keep working with --show-log and -r.
+func parseLogLine(line string) (logRecord, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return logRecord{}, false
+	}
+	var rec logRecord
+	if err := json.Unmarshal([]byte(line), &rec); err == nil {
+		return rec, true
+	}
+	parts := strings.SplitN(line, "\t", 2)
+	if len(parts) != 2 {
+		return logRecord{}, false
+	}
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return logRecord{}, false
+	}
+	return logRecord{Timestamp: ts, Fortune: strings.TrimSpace(parts[1])}, true
+}
+
+// readLogRecords reads every record from the current log and, if
+// includeRotated is set, from the gzipped rotated logs too.
+func readLogRecords(includeRotated bool) ([]logRecord, error) {
+	var records []logRecord
+
+	if b, err := os.ReadFile(logPath); err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			if rec, ok := parseLogLine(line); ok {
+				records = append(records, rec)
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if includeRotated {
+		for _, p := range rotatedLogPaths() {
+			recs, err := readGzipLogRecords(p)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[fortunebot] Failed to read %s: %v\n", p, err)
+				continue
+			}
+			records = append(records, recs...)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].Timestamp < records[j].Timestamp })
+	return records, nil
+}
+
+// readGzipLogRecords reads one rotated, gzip-compressed log file.
+func readGzipLogRecords(path string) ([]logRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var records []logRecord
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		if rec, ok := parseLogLine(scanner.Text()); ok {
+			records = append(records, rec)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// randomFortuneFromLog picks a random fortune from the log file.
+func randomFortuneFromLog() (string, error) {
+	records, err := readLogRecords(false)
+	if err != nil {
+		return "", fmt.Errorf("failed to read log: %w", err)
+	}
+	if len(records) == 0 {
+		return "", fmt.Errorf("no fortunes found in log")
+	}
+	rand.Seed(time.Now().UnixNano())
+	return records[rand.Intn(len(records))].Fortune, nil
+}
+
+// parseSince parses --since as either a duration ago ("24h", "30m") or an
+// absolute date/time (RFC3339 or "2006-01-02").
+func parseSince(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("could not parse %q as a duration or date", s)
+}
+
+// searchLog prints log records matching grep/since/model filters, newest
+// last, scanning both the current and rotated logs.
+func searchLog(grep, since, model string) error {
+	records, err := readLogRecords(true)
+	if err != nil {
+		return err
+	}
+
+	var sinceTime time.Time
+	if since != "" {
+		sinceTime, err = parseSince(since)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, rec := range records {
+		if grep != "" && !strings.Contains(rec.Fortune, grep) && !strings.Contains(rec.Prompt, grep) {
+			continue
+		}
+		if model != "" && rec.Model != model {
+			continue
+		}
+		if !sinceTime.IsZero() && time.Unix(rec.Timestamp, 0).Before(sinceTime) {
+			continue
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", time.Unix(rec.Timestamp, 0).Format(time.RFC3339), rec.Provider, rec.Model, rec.Fortune)
+	}
+	return nil
+}
+
+// printLogStats prints counts and average latency per model.
+func printLogStats() error {
+	records, err := readLogRecords(true)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		fmt.Println("[fortunebot] No log records found.")
+		return nil
+	}
+
+	type stat struct {
+		count        int
+		totalLatency int64
+	}
+	byModel := map[string]*stat{}
+	var order []string
+	for _, rec := range records {
+		key := rec.Model
+		if key == "" {
+			key = "unknown"
+		}
+		s, ok := byModel[key]
+		if !ok {
+			s = &stat{}
+			byModel[key] = s
+			order = append(order, key)
+		}
+		s.count++
+		s.totalLatency += rec.LatencyMS
+	}
+	sort.Strings(order)
+
+	fmt.Printf("%-30s %8s %14s\n", "MODEL", "COUNT", "AVG LATENCY")
+	for _, model := range order {
+		s := byModel[model]
+		avg := float64(0)
+		if s.count > 0 {
+			avg = float64(s.totalLatency) / float64(s.count)
+		}
+		fmt.Printf("%-30s %8d %11.0fms\n", model, s.count, avg)
+	}
+	return nil
+}
@@ -7,11 +7,11 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"math/rand"
-	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -30,12 +30,6 @@ var (
 	logPath    = defaultLogPath()
 )
 
-type config struct {
-	APIKey        string `json:"api_key"`
-	DefaultPrompt string `json:"default_prompt"`
-	Model         string `json:"model"`
-}
-
 type fortuneCache struct {
 	Fortune   string  `json:"fortune"`
 	Timestamp float64 `json:"timestamp"`
@@ -123,23 +117,13 @@ func applyEnvFile(path string) error {
 	return scanner.Err()
 }
 
-// loadConfig reads the optional JSON config file and fills defaults.
-func loadConfig() config {
-	b, err := os.ReadFile(configPath)
-	if err != nil {
-		return config{DefaultPrompt: defaultPrompt, Model: defaultModel}
-	}
-	var c config
-	if err := json.Unmarshal(b, &c); err != nil {
-		return config{DefaultPrompt: defaultPrompt, Model: defaultModel}
-	}
-	if c.DefaultPrompt == "" {
-		c.DefaultPrompt = defaultPrompt
+// configSourceLabel formats where a config-derived value came from, for
+// --verbose provenance messages.
+func configSourceLabel(cfg config, key string) string {
+	if cfg.ConfigFormat == "" {
+		return "built-in default"
 	}
-	if c.Model == "" {
-		c.Model = defaultModel
-	}
-	return c
+	return fmt.Sprintf("profile %q key %q in %s", cfg.ActiveProfile, key, cfg.ConfigPath)
 }
 
 // resolveAPIKeyWithSource resolves the API key and explains where it came from.
@@ -154,26 +138,30 @@ func resolveAPIKeyWithSource(cli string, cfg config) (string, string) {
 		return v, "env OPENAI_API_KEY"
 	}
 	if strings.TrimSpace(cfg.APIKey) != "" {
-		return cfg.APIKey, "~/.config/fortunebot/config.json"
+		return cfg.APIKey, configSourceLabel(cfg, "api_key")
 	}
 	return "", "none found"
 }
 
 // resolveModelWithSource resolves the model and explains where it came from.
-func resolveModelWithSource(cli string, cfg config) (string, string) {
+// The bool reports whether the caller explicitly requested this model via
+// --model/env, as opposed to it merely falling out of the profile or the
+// built-in default; newProvider uses this to decide whether a per-provider
+// model override is still allowed to apply.
+func resolveModelWithSource(cli string, cfg config) (string, string, bool) {
 	if strings.TrimSpace(cli) != "" {
-		return cli, "--model flag"
+		return cli, "--model flag", true
 	}
 	if v := os.Getenv("FORTUNEBOT_MODEL"); v != "" {
-		return v, "env FORTUNEBOT_MODEL"
+		return v, "env FORTUNEBOT_MODEL", true
 	}
 	if v := os.Getenv("OPENAI_MODEL"); v != "" {
-		return v, "env OPENAI_MODEL"
+		return v, "env OPENAI_MODEL", true
 	}
 	if strings.TrimSpace(cfg.Model) != "" {
-		return cfg.Model, "~/.config/fortunebot/config.json"
+		return cfg.Model, configSourceLabel(cfg, "model"), false
 	}
-	return defaultModel, "built-in default"
+	return defaultModel, "built-in default", false
 }
 
 // resolvePromptWithSource resolves the prompt and explains where it came from.
@@ -185,11 +173,22 @@ func resolvePromptWithSource(cli string, cfg config) (string, string) {
 		return v, "env FORTUNEBOT_PROMPT"
 	}
 	if strings.TrimSpace(cfg.DefaultPrompt) != "" {
-		return cfg.DefaultPrompt, "~/.config/fortunebot/config.json"
+		return cfg.DefaultPrompt, configSourceLabel(cfg, "prompt")
 	}
 	return defaultPrompt, "built-in default"
 }
 
+// resolveCacheTTLWithSource resolves the cache TTL and explains where it came from.
+func resolveCacheTTLWithSource(cliSet bool, cli int, cfg config) (int, string) {
+	if cliSet {
+		return cli, "--cache-ttl flag"
+	}
+	if cfg.CacheTTL != nil {
+		return *cfg.CacheTTL, configSourceLabel(cfg, "cache_ttl")
+	}
+	return cli, "built-in default"
+}
+
 // isErrorFortune detects cached error strings (we skip caching/logging them).
 func isErrorFortune(s string) bool {
 	return strings.HasPrefix(strings.TrimSpace(s), "[fortunebot]")
@@ -245,97 +244,38 @@ func clearCache() {
 	fmt.Println("[fortunebot] Cache cleared.")
 }
 
-// logFortune appends a fortune to the log file (skipping error messages).
-func logFortune(f string) {
-	if isErrorFortune(f) {
-		return
-	}
-	line := fmt.Sprintf("%d\t%s\n", time.Now().Unix(), f)
-	fh, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "[fortunebot] Failed to write log: %v\n", err)
-		return
-	}
-	defer fh.Close()
-	if _, err := fh.WriteString(line); err != nil {
-		fmt.Fprintf(os.Stderr, "[fortunebot] Failed to write log: %v\n", err)
-	}
-}
-
-// printLog streams the log file to stdout.
-func printLog() {
-	b, err := os.ReadFile(logPath)
+// generateFortune resolves the named provider and asks it for a fortune.
+// modelExplicit reports whether model came from --model/env rather than the
+// profile or built-in default; newProvider needs it to decide whether a
+// per-provider model override is still allowed to apply. parentCtx is
+// cancelled on shutdown signals; cancellation aborts the HTTP call via the
+// timeout derived from it, so no partial fortune reaches
+// saveCache/logFortune. If stream is set and the resolved provider supports
+// it, text deltas are written to out as they arrive (the returned bool
+// reports whether that happened) and the full fortune is still returned for
+// saveCache/logFortune; providers without streaming support silently fall
+// back to the regular blocking call. The returned int is the token count
+// reported by the provider's API, for logRecord.Tokens.
+func generateFortune(parentCtx context.Context, prompt, apiKey, model, providerName string, modelExplicit bool, cfg config, stream bool, out io.Writer) (string, int, bool, error) {
+	provider, err := newProvider(providerName, apiKey, model, modelExplicit, cfg)
 	if err != nil {
-		fmt.Println("[fortunebot] No log file found.")
-		return
+		return "", 0, false, err
 	}
-	fmt.Print(string(b))
-}
-
-func generateFortune(prompt, apiKey, model string) (string, error) {
-	if apiKey == "" {
-		return "", fmt.Errorf("no API key provided")
-	}
-
-	type msg struct {
-		Role    string `json:"role"`
-		Content string `json:"content"`
-	}
-	reqBody := map[string]interface{}{
-		"model":             model,
-		"input":             []msg{{Role: "system", Content: "You are a fortune cookie generator."}, {Role: "user", Content: prompt}},
-		"max_output_tokens": 60,
-		"temperature":       0.9,
-	}
-
-	payload, _ := json.Marshal(reqBody)
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel := context.WithTimeout(parentCtx, 15*time.Second)
 	defer cancel()
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.openai.com/v1/responses", strings.NewReader(string(payload)))
-	if err != nil {
-		return "", err
-	}
-	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(httpReq)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode >= 300 {
-		return "", fmt.Errorf("API error (%d): %s", resp.StatusCode, string(body))
-	}
-
-	var parsed struct {
-		Output []struct {
-			Content []struct {
-				Text string `json:"text"`
-			} `json:"content"`
-		} `json:"output"`
-		OutputText string `json:"output_text"`
-	}
-	if err := json.Unmarshal(body, &parsed); err != nil {
-		return "", err
-	}
-
-	fortune := ""
-	if len(parsed.Output) > 0 && len(parsed.Output[0].Content) > 0 {
-		fortune = strings.TrimSpace(parsed.Output[0].Content[0].Text)
-	} else if parsed.OutputText != "" {
-		fortune = strings.TrimSpace(parsed.OutputText)
-	}
-	if fortune == "" {
-		return "", fmt.Errorf("empty response from API")
+	if stream {
+		if sp, ok := provider.(StreamingProvider); ok {
+			fortune, tokens, err := sp.GenerateStream(ctx, prompt, out)
+			return fortune, tokens, err == nil, err
+		}
 	}
-	return "ðŸ¤– " + fortune, nil
+	fortune, tokens, err := provider.Generate(ctx, prompt)
+	return fortune, tokens, false, err
 }
 
 // startPrefetch spawns a detached worker process to refresh cache/log.
-func startPrefetch(prompt, apiKey, model string, verbose bool) {
+func startPrefetch(prompt, apiKey, model, providerName string, modelExplicit bool, profile string, logMaxSize int64, logMaxFiles int, verbose bool) {
 	exe, err := os.Executable()
 	if err != nil {
 		if verbose {
@@ -343,7 +283,18 @@ func startPrefetch(prompt, apiKey, model string, verbose bool) {
 		}
 		return
 	}
-	args := []string{"--prefetch-worker", "--prompt", prompt, "--model", model}
+	args := []string{
+		"--prefetch-worker", "--prompt", prompt, "--provider", providerName,
+		"--log-max-size", strconv.FormatInt(logMaxSize, 10), "--log-max-files", strconv.Itoa(logMaxFiles),
+	}
+	// A model taken from the profile is not passed on: the worker resolves it
+	// again from the same profile, so a per-provider model still applies.
+	if modelExplicit {
+		args = append(args, "--model", model)
+	}
+	if profile != "" {
+		args = append(args, "--profile", profile)
+	}
 	if apiKey != "" {
 		args = append(args, "--api-key", apiKey)
 	}
@@ -363,13 +314,42 @@ func startPrefetch(prompt, apiKey, model string, verbose bool) {
 }
 
 // runPrefetchWorker performs one fetch/save/log for the background process.
-func runPrefetchWorker(prompt, apiKey, model string) int {
-	fortune, err := generateFortune(prompt, apiKey, model)
+// It reloads config.json/config.yaml and fortunebot.env on SIGHUP and
+// cancels the in-flight fetch cleanly on SIGINT/SIGTERM. cfg is guarded by
+// cfgMu since the SIGHUP reload runs on its own goroutine (watchReload)
+// concurrently with the fetch below reading it.
+func runPrefetchWorker(prompt, apiKey, model, providerName string, modelExplicit bool, cfg config, profileFlag string, logMaxSize int64, logMaxFiles int) int {
+	var cfgMu sync.Mutex
+	watchReload(func() {
+		loadDotEnv()
+		reloaded := loadConfig(profileFlag)
+		cfgMu.Lock()
+		cfg = reloaded
+		cfgMu.Unlock()
+	}, os.Getenv("FORTUNEBOT_VERBOSE") == "true" || os.Getenv("FORTUNEBOT_VERBOSE") == "1")
+
+	ctx, stop := newShutdownContext(shutdownTimeoutDefault, false)
+	defer stop()
+
+	start := time.Now()
+	cfgMu.Lock()
+	activeCfg := cfg
+	cfgMu.Unlock()
+	fortune, tokens, _, err := generateFortune(ctx, prompt, apiKey, model, providerName, modelExplicit, activeCfg, false, nil)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "[fortunebot] Background prefetch failed: %v\n", err)
 		return 1
 	}
-	logFortune(fortune)
+	logFortune(logRecord{
+		Timestamp:  time.Now().Unix(),
+		Model:      model,
+		Provider:   providerName,
+		PromptHash: promptHash(prompt),
+		Prompt:     prompt,
+		Fortune:    fortune,
+		LatencyMS:  time.Since(start).Milliseconds(),
+		Tokens:     tokens,
+	}, logMaxSize, logMaxFiles)
 	saveCache(fortune)
 	if os.Getenv("FORTUNEBOT_VERBOSE") == "true" || os.Getenv("FORTUNEBOT_VERBOSE") == "1" {
 		fmt.Println("[fortunebot] Background prefetch complete; cache updated.")
@@ -390,36 +370,17 @@ func maskKey(k string) string {
 	return fmt.Sprintf("%s***%s", k[:4], k[len(k)-4:])
 }
 
-// randomFortuneFromLog picks a random fortune from the log file.
-func randomFortuneFromLog() (string, error) {
-	b, err := os.ReadFile(logPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to read log: %w", err)
-	}
-	lines := strings.Split(string(b), "\n")
-	var fortunes []string
-	for _, line := range lines {
-		parts := strings.SplitN(line, "\t", 2)
-		if len(parts) == 2 {
-			fortunes = append(fortunes, strings.TrimSpace(parts[1]))
-		}
-	}
-	if len(fortunes) == 0 {
-		return "", fmt.Errorf("no fortunes found in log")
-	}
-	rand.Seed(time.Now().UnixNano())
-	return fortunes[rand.Intn(len(fortunes))], nil
-}
-
 func main() {
 	loadDotEnv()
-	cfg := loadConfig()
 
 	var (
 		flagPrompt       = flag.String("prompt", "", "Override prompt for the fortune.")
 		flagAPIKey       = flag.String("api-key", "", "OpenAI API key.")
 		flagModel        = flag.String("model", "", "Model to use.")
+		flagProvider     = flag.String("provider", "", "Provider backend to use (openai-responses, openai-chat, anthropic, ollama).")
+		flagProfile      = flag.String("profile", "", "Config profile to use (see config.yaml).")
 		flagCacheTTL     = flag.Int("cache-ttl", cacheTTLDefault, "Cache TTL in seconds (0 disables cache).")
+		flagShutdownWait = flag.Duration("shutdown-timeout", shutdownTimeoutDefault, "Time to wait for an in-flight request to cancel before force-exiting on shutdown signal.")
 		flagNoCache      = flag.Bool("no-cache", false, "Disable cache.")
 		flagClearCache   = flag.Bool("clear-cache", false, "Delete cache before running.")
 		flagNoPrefetch   = flag.Bool("no-prefetch", false, "Disable background prefetch.")
@@ -428,18 +389,28 @@ func main() {
 		flagShowLog      = flag.Bool("show-log", false, "Print fortune log and exit.")
 		flagPrefetchWork = flag.Bool("prefetch-worker", false, "Internal: run as prefetch worker.")
 		flagLogRandom    = flag.Bool("log-random", false, "Print a random fortune from the log instead of calling the API.")
+		flagLogMaxSize   = flag.Int64("log-max-size", logMaxSizeDefault, "Rotate fortunebot.log once it reaches this many bytes.")
+		flagLogMaxFiles  = flag.Int("log-max-files", logMaxFilesDefault, "Number of gzipped rotated logs to keep.")
+		flagGrep         = flag.String("grep", "", "Search the log for fortunes/prompts containing this substring, then exit.")
+		flagSince        = flag.String("since", "", "With --grep, only consider records since this duration-ago (\"24h\") or date; --stats always counts every record.")
+		flagStats        = flag.Bool("stats", false, "Print fortune counts and average latency per model, then exit.")
+		flagREPL         = flag.Bool("repl", false, "Launch an interactive terminal loop for browsing and regenerating fortunes.")
+		flagStream       = flag.Bool("stream", false, "Stream the response to stdout token-by-token instead of waiting for the full fortune (falls back to blocking on providers that don't support it).")
 	)
 	// Short flag aliases
 	flag.BoolVar(flagLogRandom, "r", false, "Print a random fortune from the log instead of calling the API.")
+	flag.BoolVar(flagREPL, "i", false, "Launch an interactive terminal loop for browsing and regenerating fortunes.")
 	flag.Parse()
 
+	cfg := loadConfig(*flagProfile)
 	verbose := *flagVerbose && !*flagQuiet
 
 	if *flagPrefetchWork {
 		prompt, _ := resolvePromptWithSource(*flagPrompt, cfg)
 		apiKey, _ := resolveAPIKeyWithSource(*flagAPIKey, cfg)
-		model, _ := resolveModelWithSource(*flagModel, cfg)
-		os.Exit(runPrefetchWorker(prompt, apiKey, model))
+		model, _, modelExplicit := resolveModelWithSource(*flagModel, cfg)
+		providerName, _ := resolveProviderWithSource(*flagProvider, cfg)
+		os.Exit(runPrefetchWorker(prompt, apiKey, model, providerName, modelExplicit, cfg, *flagProfile, *flagLogMaxSize, *flagLogMaxFiles))
 	}
 
 	if *flagShowLog {
@@ -447,6 +418,22 @@ func main() {
 		return
 	}
 
+	if *flagStats {
+		if err := printLogStats(); err != nil {
+			fmt.Fprintf(os.Stderr, "[fortunebot] %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *flagGrep != "" || *flagSince != "" {
+		if err := searchLog(*flagGrep, *flagSince, *flagModel); err != nil {
+			fmt.Fprintf(os.Stderr, "[fortunebot] %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *flagLogRandom {
 		f, err := randomFortuneFromLog()
 		if err != nil {
@@ -466,10 +453,12 @@ func main() {
 
 	prompt, promptSrc := resolvePromptWithSource(*flagPrompt, cfg)
 	apiKey, apiSrc := resolveAPIKeyWithSource(*flagAPIKey, cfg)
-	model, modelSrc := resolveModelWithSource(*flagModel, cfg)
+	model, modelSrc, modelExplicit := resolveModelWithSource(*flagModel, cfg)
+	providerName, providerSrc := resolveProviderWithSource(*flagProvider, cfg)
 
 	if verbose {
 		fmt.Printf("[fortunebot] Using prompt (source: %s)\n", promptSrc)
+		fmt.Printf("[fortunebot] Using provider: %s (source: %s)\n", providerName, providerSrc)
 		fmt.Printf("[fortunebot] Using model: %s (source: %s)\n", model, modelSrc)
 		if apiKey != "" {
 			fmt.Printf("[fortunebot] Using API key from: %s (%s)\n", apiSrc, maskKey(apiKey))
@@ -478,10 +467,61 @@ func main() {
 		}
 	}
 
-	cacheTTL := *flagCacheTTL
+	if *flagREPL {
+		ctx, stop := newShutdownContext(*flagShutdownWait, verbose)
+		defer stop()
+
+		var fortune string
+		var tokens int
+		var streamed bool
+		var err error
+		if *flagStream {
+			fortune, tokens, streamed, err = generateFortune(ctx, prompt, apiKey, model, providerName, modelExplicit, cfg, true, os.Stdout)
+		} else {
+			stopSpinner := startSpinner("Fetching a fortune...")
+			fortune, tokens, streamed, err = generateFortune(ctx, prompt, apiKey, model, providerName, modelExplicit, cfg, false, nil)
+			stopSpinner()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[fortunebot] Error: %v\n", err)
+			os.Exit(1)
+		}
+		if streamed {
+			fmt.Println()
+		} else if *flagStream {
+			fmt.Println(fortune)
+		}
+		logFortune(logRecord{
+			Timestamp:  time.Now().Unix(),
+			Model:      model,
+			Provider:   providerName,
+			PromptHash: promptHash(prompt),
+			Prompt:     prompt,
+			Fortune:    fortune,
+			LatencyMS:  0,
+			Tokens:     tokens,
+		}, *flagLogMaxSize, *flagLogMaxFiles)
+		saveCache(fortune)
+		if err := runREPL(fortune, prompt, apiKey, model, providerName, modelExplicit, cfg, *flagProfile, verbose, *flagStream); err != nil {
+			fmt.Fprintf(os.Stderr, "[fortunebot] %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	cacheTTLSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "cache-ttl" {
+			cacheTTLSet = true
+		}
+	})
+	cacheTTL, cacheTTLSrc := resolveCacheTTLWithSource(cacheTTLSet, *flagCacheTTL, cfg)
 	caching := !*flagNoCache && cacheTTL > 0
 
 	if caching {
+		if verbose {
+			fmt.Printf("[fortunebot] Using cache TTL: %ds (source: %s)\n", cacheTTL, cacheTTLSrc)
+		}
 		if cache, err := loadCache(); err == nil && cache != nil {
 			if cacheIsFresh(cache, cacheTTL) {
 				if verbose {
@@ -489,7 +529,7 @@ func main() {
 				}
 				fmt.Println(cache.Fortune)
 				if !*flagNoPrefetch {
-					startPrefetch(prompt, apiKey, model, verbose)
+					startPrefetch(prompt, apiKey, model, providerName, modelExplicit, *flagProfile, *flagLogMaxSize, *flagLogMaxFiles, verbose)
 				}
 				return
 			}
@@ -498,7 +538,7 @@ func main() {
 			}
 			fmt.Println(cache.Fortune)
 			if !*flagNoPrefetch {
-				startPrefetch(prompt, apiKey, model, verbose)
+				startPrefetch(prompt, apiKey, model, providerName, modelExplicit, *flagProfile, *flagLogMaxSize, *flagLogMaxFiles, verbose)
 			}
 			return
 		}
@@ -511,18 +551,35 @@ func main() {
 		}
 	}
 
-	fortune, err := generateFortune(prompt, apiKey, model)
+	ctx, stop := newShutdownContext(*flagShutdownWait, verbose)
+	defer stop()
+
+	start := time.Now()
+	fortune, tokens, streamed, err := generateFortune(ctx, prompt, apiKey, model, providerName, modelExplicit, cfg, *flagStream, os.Stdout)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "[fortunebot] Error: %v\n", err)
 		os.Exit(1)
 	}
-	logFortune(fortune)
-	fmt.Println(fortune)
+	logFortune(logRecord{
+		Timestamp:  time.Now().Unix(),
+		Model:      model,
+		Provider:   providerName,
+		PromptHash: promptHash(prompt),
+		Prompt:     prompt,
+		Fortune:    fortune,
+		LatencyMS:  time.Since(start).Milliseconds(),
+		Tokens:     tokens,
+	}, *flagLogMaxSize, *flagLogMaxFiles)
+	if streamed {
+		fmt.Println()
+	} else {
+		fmt.Println(fortune)
+	}
 
 	if caching {
 		saveCache(fortune)
 		if !*flagNoPrefetch {
-			startPrefetch(prompt, apiKey, model, verbose)
+			startPrefetch(prompt, apiKey, model, providerName, modelExplicit, *flagProfile, *flagLogMaxSize, *flagLogMaxFiles, verbose)
 		}
 	}
 }
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const defaultProvider = "openai-responses"
+
+// providerSettings carries the per-provider overrides that can live under
+// the "providers" section of config.json or of a config.yaml profile.
+type providerSettings struct {
+	Endpoint   string `yaml:"endpoint" json:"endpoint"`
+	AuthHeader string `yaml:"auth_header" json:"auth_header"` // "bearer" (default), "x-api-key", or "none"
+	Model      string `yaml:"model" json:"model"`
+}
+
+// Provider generates a single fortune for the given prompt. It also reports
+// the total token count from the API's usage accounting, for logRecord.Tokens
+// (0 if the provider/response doesn't report one).
+type Provider interface {
+	Generate(ctx context.Context, prompt string) (string, int, error)
+}
+
+// StreamingProvider is implemented by providers that can stream their
+// response as it's generated. GenerateStream writes text deltas to out as
+// they arrive (already prefixed/assembled the same way Generate's return
+// value is) and returns the full fortune and token count once the stream
+// completes, so callers can still hand them to saveCache/logFortune
+// unchanged.
+type StreamingProvider interface {
+	Provider
+	GenerateStream(ctx context.Context, prompt string, out io.Writer) (string, int, error)
+}
+
+// resolveProviderWithSource resolves the provider name and explains where it
+// came from, mirroring resolveModelWithSource.
+func resolveProviderWithSource(cli string, cfg config) (string, string) {
+	if strings.TrimSpace(cli) != "" {
+		return cli, "--provider flag"
+	}
+	if v := os.Getenv("FORTUNEBOT_PROVIDER"); v != "" {
+		return v, "env FORTUNEBOT_PROVIDER"
+	}
+	if strings.TrimSpace(cfg.Provider) != "" {
+		return cfg.Provider, configSourceLabel(cfg, "provider")
+	}
+	return defaultProvider, "built-in default"
+}
+
+// newProvider builds the Provider named by providerName, applying any
+// per-provider overrides from cfg.Providers. The per-provider model wins
+// over a model that merely fell out of the profile or built-in default, but
+// never overrides one the caller explicitly requested via --model/env
+// (modelExplicit), since those outrank it in resolveModelWithSource's chain.
+func newProvider(providerName, apiKey, model string, modelExplicit bool, cfg config) (Provider, error) {
+	settings := cfg.Providers[providerName]
+	if settings.Model != "" && !modelExplicit {
+		model = settings.Model
+	}
+
+	switch providerName {
+	case "openai-responses":
+		return &openAIResponsesProvider{apiKey: apiKey, model: model, endpoint: firstNonEmpty(settings.Endpoint, "https://api.openai.com/v1/responses"), authHeader: settings.AuthHeader}, nil
+	case "openai-chat":
+		return &openAIChatProvider{apiKey: apiKey, model: model, endpoint: firstNonEmpty(settings.Endpoint, "https://api.openai.com/v1/chat/completions"), authHeader: settings.AuthHeader}, nil
+	case "anthropic":
+		return &anthropicMessagesProvider{apiKey: apiKey, model: model, endpoint: firstNonEmpty(settings.Endpoint, "https://api.anthropic.com/v1/messages"), authHeader: settings.AuthHeader}, nil
+	case "ollama":
+		return &ollamaProvider{model: model, endpoint: firstNonEmpty(settings.Endpoint, "http://localhost:11434/api/generate")}, nil
+	default:
+		return nil, fmt.Errorf("unknown provider %q (want openai-responses, openai-chat, anthropic, or ollama)", providerName)
+	}
+}
+
+// authHeaders builds the HTTP header(s) carrying apiKey, honoring the
+// provider's configured auth_header style ("bearer", "x-api-key", or
+// "none"); style falls back to def when unset. "none" sends no auth header
+// at all, for providers fronted by a proxy that injects its own.
+func authHeaders(style, def, apiKey string) map[string]string {
+	if style == "" {
+		style = def
+	}
+	switch style {
+	case "none":
+		return nil
+	case "x-api-key":
+		return map[string]string{"x-api-key": apiKey}
+	default:
+		return map[string]string{"Authorization": "Bearer " + apiKey}
+	}
+}
+
+// openAIResponsesProvider talks to the OpenAI Responses API.
+type openAIResponsesProvider struct {
+	apiKey     string
+	model      string
+	endpoint   string
+	authHeader string
+}
+
+func (p *openAIResponsesProvider) Generate(ctx context.Context, prompt string) (string, int, error) {
+	if p.apiKey == "" {
+		return "", 0, fmt.Errorf("no API key provided")
+	}
+
+	type msg struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	reqBody := map[string]interface{}{
+		"model":             p.model,
+		"input":             []msg{{Role: "system", Content: "You are a fortune cookie generator."}, {Role: "user", Content: prompt}},
+		"max_output_tokens": 60,
+		"temperature":       0.9,
+	}
+
+	body, err := postJSON(ctx, p.endpoint, reqBody, authHeaders(p.authHeader, "bearer", p.apiKey))
+	if err != nil {
+		return "", 0, err
+	}
+
+	var parsed struct {
+		Output []struct {
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"output"`
+		OutputText string `json:"output_text"`
+		Usage      struct {
+			TotalTokens int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", 0, err
+	}
+
+	fortune := ""
+	if len(parsed.Output) > 0 && len(parsed.Output[0].Content) > 0 {
+		fortune = strings.TrimSpace(parsed.Output[0].Content[0].Text)
+	} else if parsed.OutputText != "" {
+		fortune = strings.TrimSpace(parsed.OutputText)
+	}
+	if fortune == "" {
+		return "", 0, fmt.Errorf("empty response from API")
+	}
+	return "🤖 " + fortune, parsed.Usage.TotalTokens, nil
+}
+
+// GenerateStream streams the Responses API's SSE output, writing each text
+// delta to out as it arrives so stdout fills in token-by-token instead of
+// blocking on the full response. The token count comes from the usage
+// object on the final "response.completed" event.
+func (p *openAIResponsesProvider) GenerateStream(ctx context.Context, prompt string, out io.Writer) (string, int, error) {
+	if p.apiKey == "" {
+		return "", 0, fmt.Errorf("no API key provided")
+	}
+
+	type msg struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	reqBody := map[string]interface{}{
+		"model":             p.model,
+		"input":             []msg{{Role: "system", Content: "You are a fortune cookie generator."}, {Role: "user", Content: prompt}},
+		"max_output_tokens": 60,
+		"temperature":       0.9,
+		"stream":            true,
+	}
+
+	var text strings.Builder
+	wrote := false
+	tokens := 0
+	err := postJSONStream(ctx, p.endpoint, reqBody, authHeaders(p.authHeader, "bearer", p.apiKey), func(data string) {
+		var event struct {
+			Type     string `json:"type"`
+			Delta    string `json:"delta"`
+			Response struct {
+				Usage struct {
+					TotalTokens int `json:"total_tokens"`
+				} `json:"usage"`
+			} `json:"response"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return
+		}
+		if event.Response.Usage.TotalTokens > 0 {
+			tokens = event.Response.Usage.TotalTokens
+		}
+		if event.Delta == "" {
+			return
+		}
+		if !wrote {
+			fmt.Fprint(out, "🤖 ")
+			wrote = true
+		}
+		fmt.Fprint(out, event.Delta)
+		if f, ok := out.(interface{ Flush() error }); ok {
+			f.Flush()
+		}
+		text.WriteString(event.Delta)
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	fortune := strings.TrimSpace(text.String())
+	if fortune == "" {
+		return "", 0, fmt.Errorf("empty response from API")
+	}
+	return "🤖 " + fortune, tokens, nil
+}
+
+// openAIChatProvider talks to the OpenAI Chat Completions API.
+type openAIChatProvider struct {
+	apiKey     string
+	model      string
+	endpoint   string
+	authHeader string
+}
+
+func (p *openAIChatProvider) Generate(ctx context.Context, prompt string) (string, int, error) {
+	if p.apiKey == "" {
+		return "", 0, fmt.Errorf("no API key provided")
+	}
+
+	type msg struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	reqBody := map[string]interface{}{
+		"model":       p.model,
+		"messages":    []msg{{Role: "system", Content: "You are a fortune cookie generator."}, {Role: "user", Content: prompt}},
+		"max_tokens":  60,
+		"temperature": 0.9,
+	}
+
+	body, err := postJSON(ctx, p.endpoint, reqBody, authHeaders(p.authHeader, "bearer", p.apiKey))
+	if err != nil {
+		return "", 0, err
+	}
+
+	var parsed struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			TotalTokens int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", 0, err
+	}
+
+	fortune := ""
+	if len(parsed.Choices) > 0 {
+		fortune = strings.TrimSpace(parsed.Choices[0].Message.Content)
+	}
+	if fortune == "" {
+		return "", 0, fmt.Errorf("empty response from API")
+	}
+	return "🤖 " + fortune, parsed.Usage.TotalTokens, nil
+}
+
+// anthropicMessagesProvider talks to the Anthropic Messages API.
+type anthropicMessagesProvider struct {
+	apiKey     string
+	model      string
+	endpoint   string
+	authHeader string
+}
+
+func (p *anthropicMessagesProvider) Generate(ctx context.Context, prompt string) (string, int, error) {
+	if p.apiKey == "" {
+		return "", 0, fmt.Errorf("no API key provided")
+	}
+
+	type msg struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	reqBody := map[string]interface{}{
+		"model":      p.model,
+		"system":     "You are a fortune cookie generator.",
+		"messages":   []msg{{Role: "user", Content: prompt}},
+		"max_tokens": 60,
+	}
+
+	headers := authHeaders(p.authHeader, "x-api-key", p.apiKey)
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	headers["anthropic-version"] = "2023-06-01"
+	body, err := postJSON(ctx, p.endpoint, reqBody, headers)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var parsed struct {
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+		Usage struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", 0, err
+	}
+
+	fortune := ""
+	if len(parsed.Content) > 0 {
+		fortune = strings.TrimSpace(parsed.Content[0].Text)
+	}
+	if fortune == "" {
+		return "", 0, fmt.Errorf("empty response from API")
+	}
+	return "🤖 " + fortune, parsed.Usage.InputTokens + parsed.Usage.OutputTokens, nil
+}
+
+// ollamaProvider talks to a local Ollama server and needs no API key, so
+// auth_header has nothing to configure here.
+type ollamaProvider struct {
+	model    string
+	endpoint string
+}
+
+func (p *ollamaProvider) Generate(ctx context.Context, prompt string) (string, int, error) {
+	reqBody := map[string]interface{}{
+		"model":  p.model,
+		"prompt": "You are a fortune cookie generator.\n\n" + prompt,
+		"stream": false,
+	}
+
+	body, err := postJSON(ctx, p.endpoint, reqBody, nil)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var parsed struct {
+		Response        string `json:"response"`
+		PromptEvalCount int    `json:"prompt_eval_count"`
+		EvalCount       int    `json:"eval_count"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", 0, err
+	}
+
+	fortune := strings.TrimSpace(parsed.Response)
+	if fortune == "" {
+		return "", 0, fmt.Errorf("empty response from API")
+	}
+	return "🤖 " + fortune, parsed.PromptEvalCount + parsed.EvalCount, nil
+}
+
+// postJSON is the shared HTTP helper used by every Provider implementation.
+func postJSON(ctx context.Context, url string, reqBody interface{}, headers map[string]string) ([]byte, error) {
+	payload, _ := json.Marshal(reqBody)
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(payload)))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("API error (%d): %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+// postJSONStream is the shared helper for providers that speak
+// text/event-stream: it POSTs reqBody and calls onData with the payload of
+// each "data: ..." SSE frame as it arrives, stopping cleanly at "[DONE]" or
+// when ctx is cancelled.
+func postJSONStream(ctx context.Context, url string, reqBody interface{}, headers map[string]string, onData func(data string)) error {
+	payload, _ := json.Marshal(reqBody)
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(payload)))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	for k, v := range headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API error (%d): %s", resp.StatusCode, string(body))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			break
+		}
+		onData(data)
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var favoritesPath = filepath.Join(dataDir, "favorites.txt")
+
+// replSession holds the state a --repl loop needs across commands. cfg is
+// refreshed in place on SIGHUP (see watchReload in runREPL), so every access
+// to it goes through cfgMu the same way runPrefetchWorker guards its cfg.
+type replSession struct {
+	basePrompt    string
+	prompt        string
+	apiKey        string
+	model         string
+	providerName  string
+	modelExplicit bool
+	cfgMu         sync.Mutex
+	cfg           config
+	verbose       bool
+	stream        bool
+	current       string
+}
+
+func (s *replSession) activeCfg() config {
+	s.cfgMu.Lock()
+	defer s.cfgMu.Unlock()
+	return s.cfg
+}
+
+// runREPL launches the interactive terminal loop: n new, r reroll, s star,
+// l log history, q quit. It reuses generateFortune/saveCache/the resolver
+// stack exactly as the one-shot path does, including --stream token-by-token
+// output on (n)ew/(r)eroll when the resolved provider supports it.
+// modelExplicit reports whether model came from --model/env, so
+// generateFortune knows whether a per-provider model override may still
+// apply. initial is assumed already written to stdout by the caller when
+// stream is set (streamed, or printed whole if the provider fell back to a
+// blocking call), so it's not printed again here. Like runPrefetchWorker, it
+// watches SIGHUP and reloads cfg in place, so a long-running session picks
+// up a rotated API key or changed model without restarting.
+func runREPL(initial, prompt, apiKey, model, providerName string, modelExplicit bool, cfg config, profileFlag string, verbose, stream bool) error {
+	s := &replSession{
+		basePrompt:    prompt,
+		prompt:        prompt,
+		apiKey:        apiKey,
+		model:         model,
+		providerName:  providerName,
+		modelExplicit: modelExplicit,
+		cfg:           cfg,
+		verbose:       verbose,
+		stream:        stream,
+		current:       initial,
+	}
+
+	watchReload(func() {
+		loadDotEnv()
+		reloaded := loadConfig(profileFlag)
+		s.cfgMu.Lock()
+		s.cfg = reloaded
+		s.cfgMu.Unlock()
+	}, verbose)
+
+	reader := bufio.NewReader(os.Stdin)
+	if !stream {
+		fmt.Println(s.current)
+	}
+	for {
+		fmt.Print("[fortunebot] (n)ew  (r)eroll  (s)tar  (l)og  (q)uit > ")
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "n":
+			s.fetch()
+		case "r":
+			s.reroll(reader)
+		case "s":
+			s.star()
+		case "l":
+			s.pageLog(reader)
+		case "q", "":
+			return nil
+		default:
+			fmt.Println("[fortunebot] Unknown command.")
+		}
+	}
+}
+
+// fetch generates a fresh fortune using the session's current prompt. When
+// streaming is off it shows a spinner while the request is in flight;
+// streaming writes deltas straight to stdout instead, so the spinner would
+// just get in the way.
+func (s *replSession) fetch() {
+	ctx, stop := newShutdownContext(shutdownTimeoutDefault, s.verbose)
+	defer stop()
+
+	activeCfg := s.activeCfg()
+
+	var fortune string
+	var streamed bool
+	var err error
+	if s.stream {
+		fortune, _, streamed, err = generateFortune(ctx, s.prompt, s.apiKey, s.model, s.providerName, s.modelExplicit, activeCfg, true, os.Stdout)
+	} else {
+		stopSpinner := startSpinner("Fetching a new fortune...")
+		fortune, _, streamed, err = generateFortune(ctx, s.prompt, s.apiKey, s.model, s.providerName, s.modelExplicit, activeCfg, false, nil)
+		stopSpinner()
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[fortunebot] Error: %v\n", err)
+		return
+	}
+	s.current = fortune
+	saveCache(fortune)
+	if streamed {
+		fmt.Println()
+	} else {
+		fmt.Println(fortune)
+	}
+}
+
+// reroll asks for a tweak to the base prompt, then fetches with it.
+func (s *replSession) reroll(reader *bufio.Reader) {
+	fmt.Print("[fortunebot] Tweak the prompt (blank to keep as-is): ")
+	line, _ := reader.ReadString('\n')
+	tweak := strings.TrimSpace(line)
+	if tweak != "" {
+		s.prompt = s.basePrompt + " " + tweak
+	}
+	s.fetch()
+}
+
+// star appends the current fortune to the favorites file under dataDir.
+func (s *replSession) star() {
+	if s.current == "" || isErrorFortune(s.current) {
+		fmt.Println("[fortunebot] Nothing to star yet.")
+		return
+	}
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "[fortunebot] Failed to create data dir: %v\n", err)
+		return
+	}
+	fh, err := os.OpenFile(favoritesPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[fortunebot] Failed to open favorites: %v\n", err)
+		return
+	}
+	defer fh.Close()
+	if _, err := fmt.Fprintf(fh, "%s\t%s\n", time.Now().Format(time.RFC3339), s.current); err != nil {
+		fmt.Fprintf(os.Stderr, "[fortunebot] Failed to save favorite: %v\n", err)
+		return
+	}
+	fmt.Println("[fortunebot] Starred to", favoritesPath)
+}
+
+// pageLog pages through log history, newest first, a screenful at a time.
+func (s *replSession) pageLog(reader *bufio.Reader) {
+	const pageSize = 10
+
+	records, err := readLogRecords(true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[fortunebot] %v\n", err)
+		return
+	}
+	if len(records) == 0 {
+		fmt.Println("[fortunebot] No log records found.")
+		return
+	}
+
+	for i := len(records) - 1; i >= 0; i -= pageSize {
+		start := i
+		end := i - pageSize + 1
+		if end < 0 {
+			end = 0
+		}
+		for j := start; j >= end; j-- {
+			rec := records[j]
+			fmt.Printf("%s\t%s\n", time.Unix(rec.Timestamp, 0).Format(time.RFC3339), rec.Fortune)
+		}
+		if end == 0 {
+			return
+		}
+		fmt.Print("[fortunebot] -- more (enter to continue, q to stop) --")
+		line, rerr := reader.ReadString('\n')
+		if rerr != nil || strings.ToLower(strings.TrimSpace(line)) == "q" {
+			return
+		}
+	}
+}
+
+var spinnerFrames = []rune{'⠋', '⠙', '⠹', '⠸', '⠼', '⠴', '⠦', '⠧', '⠇', '⠏'}
+
+// startSpinner prints a small rotating spinner with label until the
+// returned stop func is called, similar to a pb.ProgressBar for long
+// fetches. It redraws in place on the current line and is safe to use
+// around a single HTTP call.
+func startSpinner(label string) func() {
+	done := make(chan struct{})
+	go func() {
+		i := 0
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				fmt.Printf("\r%c %s", spinnerFrames[i%len(spinnerFrames)], label)
+				i++
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		fmt.Printf("\r%s\r", strings.Repeat(" ", len(label)+2))
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const shutdownTimeoutDefault = 5 * time.Second
+
+// newShutdownContext returns a context that is cancelled on SIGINT/SIGTERM,
+// so an in-flight HTTP call can be aborted via the existing
+// context.WithTimeout in generateFortune instead of leaving a partial
+// fortune behind. If the work hasn't wound down within shutdownTimeout of
+// the signal arriving, the process force-exits. Call the returned stop
+// func once the work it guards has finished. SIGHUP is handled separately
+// by watchReload, since it should reload config rather than cancel work.
+func newShutdownContext(shutdownTimeout time.Duration, verbose bool) (context.Context, func()) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			if verbose {
+				fmt.Fprintln(os.Stderr, "[fortunebot] Shutdown signal received, cancelling in-flight request...")
+			}
+			select {
+			case <-done:
+			case <-time.After(shutdownTimeout):
+				fmt.Fprintf(os.Stderr, "[fortunebot] Shutdown timed out after %s, forcing exit.\n", shutdownTimeout)
+				os.Exit(1)
+			}
+		case <-done:
+		}
+	}()
+
+	return ctx, func() { close(done); stop() }
+}
+
+// watchReload invokes reload every time the process receives SIGHUP,
+// without restarting. Intended for long-running modes (the prefetch
+// worker, --repl) where config.json/config.yaml and fortunebot.env can be
+// refreshed in place; the one-shot CLI path has nothing to reload into.
+func watchReload(reload func(), verbose bool) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			if verbose {
+				fmt.Fprintln(os.Stderr, "[fortunebot] SIGHUP received, reloading config and fortunebot.env...")
+			}
+			reload()
+		}
+	}()
+}